@@ -0,0 +1,243 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// addrKind identifies the shape of a cluster-local DNS name passed to NewPodForwarder.
+type addrKind int
+
+const (
+	// addrKindPod is a pod DNS name: <pod>.<namespace>.pod.cluster.local.
+	addrKindPod addrKind = iota
+	// addrKindService is a (non-headless) Service DNS name: <svc>.<namespace>.svc.cluster.local.
+	addrKindService
+	// addrKindHeadlessServicePod is a headless Service's per-pod DNS name, as used by
+	// StatefulSets: <pod-hostname>.<svc>.<namespace>.svc.cluster.local.
+	addrKindHeadlessServicePod
+)
+
+// parsedAddr is the result of parsing a cluster-local DNS name, carrying enough information
+// to route a dial through the right strategy: straight to a named pod, or by resolving a
+// Service to one of its ready endpoints first.
+type parsedAddr struct {
+	kind addrKind
+	// pod is set for addrKindPod (the target pod) and addrKindHeadlessServicePod (just the
+	// pod name; its namespace is service.Namespace).
+	pod types.NamespacedName
+	// service is set for addrKindService and addrKindHeadlessServicePod.
+	service types.NamespacedName
+}
+
+// parsePodAddr parses addr, a cluster-local DNS name, into a parsedAddr describing what kind
+// of object it refers to. Supported forms are:
+//
+//	<pod>.<namespace>.pod.cluster.local                   (a pod)
+//	<svc>.<namespace>.svc.cluster.local                   (a Service)
+//	<pod-hostname>.<svc>.<namespace>.svc.cluster.local     (a headless Service's pod)
+func parsePodAddr(addr string) (*parsedAddr, error) {
+	parts := strings.Split(addr, ".")
+
+	switch {
+	case len(parts) == 5 && parts[2] == "pod" && parts[3] == "cluster":
+		return &parsedAddr{
+			kind: addrKindPod,
+			pod:  types.NamespacedName{Namespace: parts[1], Name: parts[0]},
+		}, nil
+
+	case len(parts) == 5 && parts[2] == "svc" && parts[3] == "cluster":
+		return &parsedAddr{
+			kind:    addrKindService,
+			service: types.NamespacedName{Namespace: parts[1], Name: parts[0]},
+		}, nil
+
+	case len(parts) == 6 && parts[3] == "svc" && parts[4] == "cluster":
+		return &parsedAddr{
+			kind:    addrKindHeadlessServicePod,
+			pod:     types.NamespacedName{Name: parts[0]},
+			service: types.NamespacedName{Namespace: parts[2], Name: parts[1]},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported pod address format: %s", addr)
+	}
+}
+
+// targetPod returns the NamespacedName of the pod addr refers to directly, without needing to
+// resolve a Service to one of its endpoints. It must not be called for addrKindService.
+func (a *parsedAddr) targetPod() types.NamespacedName {
+	switch a.kind {
+	case addrKindHeadlessServicePod:
+		return types.NamespacedName{Namespace: a.service.Namespace, Name: a.pod.Name}
+	default:
+		return a.pod
+	}
+}
+
+// endpointResolver resolves a Service to one of its currently ready endpoint pods.
+type endpointResolver interface {
+	Resolve(ctx context.Context, svc types.NamespacedName, port string) (pod types.NamespacedName, targetPort string, err error)
+}
+
+var (
+	endpointListerOnce sync.Once
+	endpointLister     discoverylisters.EndpointSliceLister
+	endpointListerErr  error
+)
+
+// getEndpointSliceLister lazily starts a SharedInformerFactory for EndpointSlices and returns
+// its (cached, auto-updating) lister, shared by every podForwarder in the process.
+func getEndpointSliceLister() (discoverylisters.EndpointSliceLister, error) {
+	endpointListerOnce.Do(func() {
+		_, cs, err := getClientConfig()
+		if err != nil {
+			endpointListerErr = err
+			return
+		}
+
+		factory := informers.NewSharedInformerFactory(cs, 10*time.Minute)
+		informer := factory.Discovery().V1beta1().EndpointSlices()
+		endpointLister = informer.Lister()
+
+		stopCh := make(chan struct{})
+		factory.Start(stopCh)
+		factory.WaitForCacheSync(stopCh)
+	})
+	return endpointLister, endpointListerErr
+}
+
+var (
+	podInformerOnce sync.Once
+	podInformer     cache.SharedIndexInformer
+	podInformerErr  error
+)
+
+// getPodInformer lazily starts a SharedInformerFactory for Pods and returns its (cached,
+// auto-updating) informer, shared by every ForwarderPool in the process.
+func getPodInformer() (cache.SharedIndexInformer, error) {
+	podInformerOnce.Do(func() {
+		_, cs, err := getClientConfig()
+		if err != nil {
+			podInformerErr = err
+			return
+		}
+
+		factory := informers.NewSharedInformerFactory(cs, 10*time.Minute)
+		podInformer = factory.Core().V1().Pods().Informer()
+
+		stopCh := make(chan struct{})
+		factory.Start(stopCh)
+		factory.WaitForCacheSync(stopCh)
+	})
+	return podInformer, podInformerErr
+}
+
+// defaultEndpointResolver resolves Services to endpoints via a cached EndpointSlice lister,
+// re-listing (and so picking up any change) on every call.
+type defaultEndpointResolver struct{}
+
+// kubernetesServiceNameLabel is set by the endpointslice controller on every EndpointSlice to
+// the Service it belongs to.
+const kubernetesServiceNameLabel = "kubernetes.io/service-name"
+
+func (defaultEndpointResolver) Resolve(
+	_ context.Context,
+	svc types.NamespacedName,
+	port string,
+) (types.NamespacedName, string, error) {
+	_, cs, err := getClientConfig()
+	if err != nil {
+		return types.NamespacedName{}, "", err
+	}
+
+	svcObj, err := cs.CoreV1().Services(svc.Namespace).Get(svc.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return types.NamespacedName{}, "", ErrPodNotFound
+		}
+		return types.NamespacedName{}, "", err
+	}
+
+	portName, err := servicePortName(svcObj, port)
+	if err != nil {
+		return types.NamespacedName{}, "", err
+	}
+
+	lister, err := getEndpointSliceLister()
+	if err != nil {
+		return types.NamespacedName{}, "", err
+	}
+
+	selector := labels.Set{kubernetesServiceNameLabel: svc.Name}.AsSelector()
+	slices, err := lister.EndpointSlices(svc.Namespace).List(selector)
+	if err != nil {
+		return types.NamespacedName{}, "", err
+	}
+
+	for _, slice := range slices {
+		targetPort, ok := matchingPort(slice.Ports, portName)
+		if !ok {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			if !endpointReady(ep) || ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+				continue
+			}
+			return types.NamespacedName{Namespace: svc.Namespace, Name: ep.TargetRef.Name}, targetPort, nil
+		}
+	}
+
+	return types.NamespacedName{}, "", ErrPodNotFound
+}
+
+// servicePortName returns the name of the Service port matching requested (a numeric Service
+// port or a port name), so it can be matched against the unrelated port numbering used by the
+// pods backing it. An unnamed port matches by the empty string.
+func servicePortName(svc *corev1.Service, requested string) (string, error) {
+	requestedNum, numeric := -1, false
+	if n, err := strconv.Atoi(requested); err == nil {
+		requestedNum, numeric = n, true
+	}
+
+	for _, p := range svc.Spec.Ports {
+		if p.Name == requested || (numeric && int(p.Port) == requestedNum) {
+			return p.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("service %s/%s has no port matching %s", svc.Namespace, svc.Name, requested)
+}
+
+// matchingPort returns the numeric pod-side port from ports with the given name, along with
+// whether a match was found. name is "" for a Service's sole, unnamed port.
+func matchingPort(ports []discoveryv1beta1.EndpointPort, name string) (string, bool) {
+	for _, p := range ports {
+		portName := ""
+		if p.Name != nil {
+			portName = *p.Name
+		}
+		if portName == name && p.Port != nil {
+			return strconv.Itoa(int(*p.Port)), true
+		}
+	}
+	return "", false
+}
+
+func endpointReady(ep discoveryv1beta1.Endpoint) bool {
+	return ep.Conditions.Ready == nil || *ep.Conditions.Ready
+}
@@ -0,0 +1,72 @@
+package portforward
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type stubEndpointResolver struct {
+	pod        types.NamespacedName
+	targetPort string
+	err        error
+
+	gotService types.NamespacedName
+	gotPort    string
+}
+
+func (s *stubEndpointResolver) Resolve(
+	_ context.Context,
+	svc types.NamespacedName,
+	port string,
+) (types.NamespacedName, string, error) {
+	s.gotService = svc
+	s.gotPort = port
+	return s.pod, s.targetPort, s.err
+}
+
+func Test_podForwarder_DialContext_resolvesServiceEndpoint(t *testing.T) {
+	forwarder, err := NewPodForwarder("tcp", "es-http.bar.svc.cluster.local:9200")
+	require.NoError(t, err)
+
+	resolver := &stubEndpointResolver{
+		pod:        types.NamespacedName{Namespace: "bar", Name: "es-0"},
+		targetPort: "9200",
+	}
+	forwarder.endpointResolver = resolver
+
+	var gotNamespace, gotPodName, gotPodPort, gotBindHost string
+	forwarder.portForwarderFactory = PortForwarderFactory(func(namespace, podName, podPort, bindHost string) PortForwarder {
+		gotNamespace, gotPodName, gotPodPort, gotBindHost = namespace, podName, podPort, bindHost
+		return &stubPortForwarder{address: net.JoinHostPort(bindHost, "12345")}
+	})
+
+	dialer := &capturingDialer{}
+	forwarder.dialerFunc = dialer.DialContext
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	wg := make(chan struct{})
+	go func() {
+		defer close(wg)
+		_ = forwarder.Run(ctx)
+	}()
+
+	_, err = forwarder.DialContext(context.Background())
+	require.NoError(t, err)
+
+	cancel()
+	<-wg
+
+	assert.Equal(t, types.NamespacedName{Namespace: "bar", Name: "es-http"}, resolver.gotService)
+	assert.Equal(t, "9200", resolver.gotPort)
+	assert.Equal(t, "bar", gotNamespace)
+	assert.Equal(t, "es-0", gotPodName)
+	assert.Equal(t, "9200", gotPodPort)
+	assert.Equal(t, DefaultBindHost, gotBindHost)
+	assert.Equal(t, []string{"127.0.0.1:12345"}, dialer.addresses)
+}
@@ -0,0 +1,73 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// sentinelError pairs one of the package's sentinel errors with the raw detail it was parsed
+// from, so logs keep the detail while callers can still match on the sentinel with errors.Is.
+type sentinelError struct {
+	sentinel error
+	detail   string
+}
+
+func (e *sentinelError) Error() string { return fmt.Sprintf("%s: %s", e.sentinel, e.detail) }
+func (e *sentinelError) Unwrap() error { return e.sentinel }
+
+// Sentinel errors returned from Run and DialContext, so callers can tell a terminal failure
+// ("pod is gone, give up") apart from a transient one ("API-server hiccup, retry").
+var (
+	// ErrPodNotFound means the target pod (or, for a Service address, the Service or any ready
+	// endpoint pod behind it) could not be found when the forward or the dial was set up.
+	ErrPodNotFound = errors.New("portforward: pod not found")
+	// ErrPortClosed means the forward was established but the connection to the target port
+	// was subsequently closed. It is returned from Run and passed to the OnError hook;
+	// DialContext does not return it.
+	ErrPortClosed = errors.New("portforward: port closed")
+	// ErrForwardTimeout means the forward did not become ready within its configured timeout.
+	ErrForwardTimeout = errors.New("portforward: timed out waiting for forward to become ready")
+)
+
+// ErrorPhase identifies which stage of a forward's lifecycle an OnErrorFunc fired for.
+type ErrorPhase string
+
+const (
+	// PhaseSetup covers failures standing up the forward itself: the PortForwarder's Start
+	// failing, or a Service address not resolving to a ready endpoint. Dial errors are not
+	// reported.
+	PhaseSetup ErrorPhase = "setup"
+	// PhaseReady covers the forward not becoming ready before its readyTimeout.
+	PhaseReady ErrorPhase = "ready"
+	// PhaseDisconnect covers the forward failing after having been ready at least once.
+	PhaseDisconnect ErrorPhase = "disconnect"
+)
+
+// OnErrorFunc is invoked by a podForwarder whenever its forward fails, with the phase the
+// failure happened in.
+type OnErrorFunc func(phase ErrorPhase, err error)
+
+var forwardErrorPatterns = []struct {
+	re       *regexp.Regexp
+	sentinel error
+}{
+	{regexp.MustCompile(`(?i)use of closed network connection`), ErrPortClosed},
+	{regexp.MustCompile(`(?i)lost connection to pod`), ErrPortClosed},
+}
+
+// classifyForwardError maps a client-go port-forward failure to one of the package's
+// sentinel errors where possible, falling back to the original error otherwise.
+func classifyForwardError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	for _, p := range forwardErrorPatterns {
+		if p.re.MatchString(msg) {
+			return &sentinelError{sentinel: p.sentinel, detail: strings.TrimSpace(msg)}
+		}
+	}
+	return err
+}
@@ -0,0 +1,263 @@
+package portforward
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// execStartupQuiet is how long socat's stderr must stay quiet, with no line matching
+// socatStderrPatterns, before DialContext assumes the stream came up cleanly. This is normally
+// what ends the wait: a healthy socat prints nothing at all, so nothing ever arrives to signal
+// success explicitly.
+const execStartupQuiet = 200 * time.Millisecond
+
+// execStartupGrace is the absolute upper bound DialContext waits for socat to fail or go quiet,
+// in case the quiet-period check above is somehow never reached.
+const execStartupGrace = 2 * time.Second
+
+// Sentinel errors socat failures are classified into, so callers can tell a closed target port
+// apart from an unresolvable address or a malformed request, instead of string-matching exec
+// output themselves.
+var (
+	ErrConnectionRefused = errors.New("portforward: connection refused")
+	ErrHostUnknown       = errors.New("portforward: name or service not known")
+	ErrInvalidPort       = errors.New("portforward: invalid port")
+)
+
+var socatStderrPatterns = []struct {
+	re       *regexp.Regexp
+	sentinel error
+}{
+	{regexp.MustCompile(`(?i)connection refused`), ErrConnectionRefused},
+	{regexp.MustCompile(`(?i)name or service not known`), ErrHostUnknown},
+	{regexp.MustCompile(`(?i)invalid port|parse address.*port`), ErrInvalidPort},
+}
+
+// classifySocatStderr maps a line of socat stderr output to a typed error, or returns nil if
+// the line doesn't match a known failure pattern.
+func classifySocatStderr(line string) error {
+	for _, p := range socatStderrPatterns {
+		if p.re.MatchString(line) {
+			return &sentinelError{sentinel: p.sentinel, detail: strings.TrimSpace(line)}
+		}
+	}
+	return nil
+}
+
+// execDialerFactory builds the execDialer used to reach a given pod, overridable in tests.
+type execDialerFactory func(podNSN types.NamespacedName) (*execDialer, error)
+
+// executorFactory builds the remotecommand.Executor DialContext streams the connection over,
+// overridable in tests so they can exercise DialContext without a real API server.
+type executorFactory func(config *rest.Config, method string, url *url.URL) (remotecommand.Executor, error)
+
+// execDialer reaches a pod by exec-ing socat into one of its containers and streaming the
+// connection over the exec subresource, instead of opening a SPDY port-forward.
+type execDialer struct {
+	restConfig *rest.Config
+	clientset  kubernetes.Interface
+	namespace  string
+	podName    string
+	container  string
+
+	newExecutor executorFactory
+}
+
+func newExecDialer(podNSN types.NamespacedName) (*execDialer, error) {
+	cfg, cs, err := getClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &execDialer{
+		restConfig:  cfg,
+		clientset:   cs,
+		namespace:   podNSN.Namespace,
+		podName:     podNSN.Name,
+		newExecutor: remotecommand.NewSPDYExecutor,
+	}, nil
+}
+
+// DialContext execs socat into the target pod and returns a net.Conn wrapping its stdin/stdout.
+func (d *execDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return nil, &sentinelError{sentinel: ErrInvalidPort, detail: err.Error()}
+	}
+
+	if _, err := d.clientset.CoreV1().Pods(d.namespace).Get(d.podName, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, ErrPodNotFound
+		}
+		return nil, err
+	}
+
+	proto := "TCP"
+	if network == "udp" || network == "udp4" || network == "udp6" {
+		proto = "UDP"
+	}
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+
+	// cancel unblocks Stream's internal copy loops by closing every pipe end Stream itself
+	// reads from or writes to. This client-go version's StreamOptions has no context of its
+	// own, so this -- rather than any form of context cancellation -- is what actually makes
+	// execConn.Close tear down a stream whose remote process has stopped responding.
+	var cancelOnce sync.Once
+	cancel := func() {
+		cancelOnce.Do(func() {
+			_ = stdinR.Close()
+			_ = stdoutW.Close()
+			_ = stderrW.Close()
+		})
+	}
+
+	req := d.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(d.namespace).
+		Name(d.podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: d.container,
+			Command:   []string{"socat", "-", fmt.Sprintf("%s:127.0.0.1:%s", proto, port)},
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := d.newExecutor(d.restConfig, http.MethodPost, req.URL())
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	errChan := make(chan error, 1)
+	startedChan := make(chan struct{})
+
+	go func() {
+		err := executor.Stream(remotecommand.StreamOptions{
+			Stdin:  stdinR,
+			Stdout: stdoutW,
+			Stderr: stderrW,
+		})
+		_ = stdoutW.Close()
+		_ = stderrW.Close()
+		if err != nil {
+			select {
+			case errChan <- err:
+			default:
+			}
+		}
+	}()
+
+	lineChan := make(chan string)
+	go func() {
+		defer close(lineChan)
+		scanner := bufio.NewScanner(stderrR)
+		for scanner.Scan() {
+			lineChan <- scanner.Text()
+		}
+	}()
+
+	// This watches for an explicit failure on stderr, but otherwise doesn't wait for stderr to
+	// close: a healthy socat runs silently for as long as the connection is open, so stderr only
+	// closes once the stream itself ends. Instead, startedChan fires once execStartupQuiet has
+	// passed with no new line, treating silence as success the same way a human watching the
+	// log would.
+	go func() {
+		quiet := time.NewTimer(execStartupQuiet)
+		defer quiet.Stop()
+		for {
+			select {
+			case line, ok := <-lineChan:
+				if !ok {
+					close(startedChan)
+					return
+				}
+				if classified := classifySocatStderr(line); classified != nil {
+					select {
+					case errChan <- classified:
+					default:
+					}
+					cancel()
+					return
+				}
+				if !quiet.Stop() {
+					<-quiet.C
+				}
+				quiet.Reset(execStartupQuiet)
+			case <-quiet.C:
+				close(startedChan)
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-errChan:
+		cancel()
+		return nil, err
+	case <-startedChan:
+	case <-time.After(execStartupGrace):
+	case <-ctx.Done():
+		cancel()
+		return nil, ctx.Err()
+	}
+
+	return &execConn{stdin: stdinW, stdout: stdoutR, cancel: cancel}, nil
+}
+
+// execConn adapts the piped stdin/stdout of a socat exec session to net.Conn.
+type execConn struct {
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	cancel func()
+}
+
+func (c *execConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *execConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+// Close tears down the exec stream, including unblocking the Stream goroutine backing it even
+// if the remote process has stopped reading or writing, and closes our own ends of the
+// stdin/stdout pipes.
+func (c *execConn) Close() error {
+	c.cancel()
+	_ = c.stdin.Close()
+	return c.stdout.Close()
+}
+
+func (c *execConn) LocalAddr() net.Addr                { return execAddr{} }
+func (c *execConn) RemoteAddr() net.Addr               { return execAddr{} }
+func (c *execConn) SetDeadline(t time.Time) error      { return nil }
+func (c *execConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *execConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// execAddr is a placeholder net.Addr: an exec stream has no TCP/UDP address of its own.
+type execAddr struct{}
+
+func (execAddr) Network() string { return "exec" }
+func (execAddr) String() string  { return "exec" }
@@ -0,0 +1,113 @@
+package portforward
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+func Test_classifySocatStderr(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantErr     bool
+		wantWrapped error
+	}{
+		{
+			name:        "connection refused",
+			line:        "2020/01/01 00:00:00 socat[1] E connect(5, AF=2 127.0.0.1:9300, 16): Connection refused",
+			wantErr:     true,
+			wantWrapped: ErrConnectionRefused,
+		},
+		{
+			name:        "name or service not known",
+			line:        "2020/01/01 00:00:00 socat[1] E getaddrinfo(\"es-nonexistent\", \"9200\", ...): Name or service not known",
+			wantErr:     true,
+			wantWrapped: ErrHostUnknown,
+		},
+		{
+			name:        "invalid port",
+			line:        "2020/01/01 00:00:00 socat[1] E parse address \"TCP:127.0.0.1:notaport\" option 2 \"notaport\": invalid port",
+			wantErr:     true,
+			wantWrapped: ErrInvalidPort,
+		},
+		{
+			name: "unrelated line",
+			line: "2020/01/01 00:00:00 socat[1] I listening on AF=2 127.0.0.1:9200",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifySocatStderr(tt.line)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.ErrorIs(t, err, tt.wantWrapped)
+		})
+	}
+}
+
+// blockingExecutor simulates a remote socat process that accepts the exec stream but never
+// reads or writes anything on it, as if stuck, until its Stdin pipe is torn down from our side.
+type blockingExecutor struct {
+	streamStarted chan struct{}
+	streamDone    chan struct{}
+}
+
+func (e *blockingExecutor) Stream(options remotecommand.StreamOptions) error {
+	close(e.streamStarted)
+	_, _ = io.Copy(ioutil.Discard, options.Stdin)
+	close(e.streamDone)
+	return nil
+}
+
+func Test_execDialer_Close_unblocksStuckStream(t *testing.T) {
+	cs := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "bar", Name: "foo"},
+	})
+
+	streamStarted := make(chan struct{})
+	streamDone := make(chan struct{})
+
+	d := &execDialer{
+		restConfig: &rest.Config{},
+		clientset:  cs,
+		namespace:  "bar",
+		podName:    "foo",
+		newExecutor: func(_ *rest.Config, _ string, _ *url.URL) (remotecommand.Executor, error) {
+			return &blockingExecutor{streamStarted: streamStarted, streamDone: streamDone}, nil
+		},
+	}
+
+	start := time.Now()
+	conn, err := d.DialContext(context.Background(), "tcp", "127.0.0.1:9200")
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), execStartupGrace, "a dial with a quiet stderr should return once execStartupQuiet elapses, not wait out the full execStartupGrace")
+
+	select {
+	case <-streamStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("exec stream never started")
+	}
+
+	require.NoError(t, conn.Close())
+
+	select {
+	case <-streamDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not unblock a stream whose remote process never drains stdin")
+	}
+}
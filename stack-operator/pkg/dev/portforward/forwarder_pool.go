@@ -0,0 +1,273 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultForwarderIdleTTL is how long a pooled forward is kept alive after its last
+// DialContext caller goes away, in case another caller shows up shortly after.
+const DefaultForwarderIdleTTL = 1 * time.Minute
+
+// pooledForwarderKey identifies one cached podForwarder. Exactly one of pod and service is set:
+// pod for a forward addressed directly at a pod (addrKindPod or addrKindHeadlessServicePod),
+// service for one that resolves a Service to an endpoint on every (re)connect
+// (addrKindService). Keeping them in separate fields, rather than folding both into a single
+// NamespacedName, keeps a pod and a same-named Service in the same namespace from colliding on
+// the same cache entry.
+type pooledForwarderKey struct {
+	pod     types.NamespacedName
+	service types.NamespacedName
+	port    string
+}
+
+// poolKeyFor returns the cache key a forward for addr and port is stored under.
+func poolKeyFor(addr *parsedAddr, port string) pooledForwarderKey {
+	if addr.kind == addrKindService {
+		return pooledForwarderKey{service: addr.service, port: port}
+	}
+	return pooledForwarderKey{pod: addr.targetPod(), port: port}
+}
+
+// pooledForwarder is a refcounted podForwarder kept alive across DialContext calls.
+type pooledForwarder struct {
+	forwarder *podForwarder
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	refCount  int
+	idleSince time.Time
+}
+
+// ForwarderPool caches podForwarders across DialContext calls, keyed by target pod (or Service)
+// and port, so that many short-lived connections to the same pod (health checks, requeues,
+// license checks, shard operations) share a single underlying port-forward instead of opening
+// one per dial. Forwards are reference-counted while in use and evicted after IdleTTL once
+// their last caller is done with them. Call WatchPods to also evict a forward as soon as its
+// pod disappears, instead of waiting out the TTL.
+type ForwarderPool struct {
+	// IdleTTL is how long an unused forward is kept before being torn down. Defaults to
+	// DefaultForwarderIdleTTL when zero.
+	IdleTTL time.Duration
+	// Options are applied to every podForwarder created by the pool.
+	Options []PodForwarderOption
+
+	mu         sync.Mutex
+	forwarders map[pooledForwarderKey]*pooledForwarder
+}
+
+// NewForwarderPool creates an empty ForwarderPool using DefaultForwarderIdleTTL.
+func NewForwarderPool(opts ...PodForwarderOption) *ForwarderPool {
+	return &ForwarderPool{
+		IdleTTL:    DefaultForwarderIdleTTL,
+		Options:    opts,
+		forwarders: make(map[pooledForwarderKey]*pooledForwarder),
+	}
+}
+
+// DialContext dials addr, reusing a cached port-forward for its pod and port if one is
+// already running, or starting a new one otherwise. It has the same signature as
+// http.Transport.DialContext so it can be wired in directly.
+func (p *ForwarderPool) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	pf, release, err := p.acquire(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pf.DialContext(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return &pooledConn{Conn: conn, release: release}, nil
+}
+
+// acquire returns the pooled podForwarder for addr, starting it if necessary, along with a
+// release func the caller must call exactly once when done with the returned forwarder.
+func (p *ForwarderPool) acquire(network, addr string) (*podForwarder, func(), error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed, err := parsePodAddr(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := poolKeyFor(parsed, port)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.forwarders[key]
+	if !ok {
+		forwarder, err := NewPodForwarder(network, addr, p.Options...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		entry = &pooledForwarder{forwarder: forwarder, cancel: cancel, done: make(chan struct{})}
+		p.forwarders[key] = entry
+
+		go func() {
+			defer close(entry.done)
+			_ = forwarder.Run(ctx)
+		}()
+	}
+
+	entry.refCount++
+
+	return entry.forwarder, func() { p.release(key) }, nil
+}
+
+// release decrements the refcount for key, and starts the idle-eviction clock once it drops
+// to zero.
+func (p *ForwarderPool) release(key pooledForwarderKey) {
+	p.mu.Lock()
+	entry, ok := p.forwarders[key]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+
+	entry.refCount--
+	if entry.refCount > 0 {
+		p.mu.Unlock()
+		return
+	}
+
+	entry.idleSince = time.Now()
+	ttl := p.idleTTL()
+	p.mu.Unlock()
+
+	time.AfterFunc(ttl, func() { p.evictIfIdle(key, ttl) })
+}
+
+// evictIfIdle tears down the forward for key if it has been idle for at least ttl since
+// evictIfIdle was scheduled, guarding against a caller having re-acquired it in the meantime.
+func (p *ForwarderPool) evictIfIdle(key pooledForwarderKey, ttl time.Duration) {
+	p.mu.Lock()
+	entry, ok := p.forwarders[key]
+	if !ok || entry.refCount > 0 || time.Since(entry.idleSince) < ttl {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.forwarders, key)
+	p.mu.Unlock()
+
+	teardown(entry)
+}
+
+// Evict tears down every cached forward addressed directly at pod, across all of its ports,
+// immediately, regardless of idle state. Call this when a shared informer reports the pod has
+// disappeared, so a stale forward doesn't linger until its TTL expires. It has no effect on
+// forwards reaching pod only indirectly, by resolving a Service it happens to back; those are
+// re-resolved on their own once the pod drops out of the Service's ready endpoints.
+func (p *ForwarderPool) Evict(pod types.NamespacedName) {
+	p.mu.Lock()
+	var keys []pooledForwarderKey
+	for key := range p.forwarders {
+		if key.pod == pod {
+			keys = append(keys, key)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, key := range keys {
+		p.evictKey(key)
+	}
+}
+
+// evictKey tears down the cached forward for key immediately, if one is still cached.
+func (p *ForwarderPool) evictKey(key pooledForwarderKey) {
+	p.mu.Lock()
+	entry, ok := p.forwarders[key]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.forwarders, key)
+	p.mu.Unlock()
+
+	teardown(entry)
+}
+
+// teardown cancels entry's forward and waits for its Run goroutine to return.
+func teardown(entry *pooledForwarder) {
+	entry.cancel()
+	<-entry.done
+}
+
+// WatchPods registers the pool for eager eviction: as soon as the shared Pod informer used
+// throughout this package observes a pod being deleted, any cached forward addressed directly
+// at that pod is torn down immediately rather than lingering until its IdleTTL expires. Call it
+// once after constructing the pool, from a context where the in-cluster client config the rest
+// of the package relies on is available.
+func (p *ForwarderPool) WatchPods() error {
+	informer, err := getPodInformer()
+	if err != nil {
+		return err
+	}
+	informer.AddEventHandler(p.podDeleteHandler())
+	return nil
+}
+
+// podDeleteHandler builds the event handler WatchPods registers on the shared Pod informer,
+// factored out of WatchPods so it can be exercised against a locally-constructed informer in
+// tests, instead of only the process-wide singleton getPodInformer returns.
+func (p *ForwarderPool) podDeleteHandler() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			pod, ok := obj.(*corev1.Pod)
+			if !ok {
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					return
+				}
+				pod, ok = tombstone.Obj.(*corev1.Pod)
+				if !ok {
+					return
+				}
+			}
+			p.Evict(types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
+		},
+	}
+}
+
+func (p *ForwarderPool) idleTTL() time.Duration {
+	if p.IdleTTL <= 0 {
+		return DefaultForwarderIdleTTL
+	}
+	return p.IdleTTL
+}
+
+// pooledConn wraps a net.Conn borrowed from a ForwarderPool, releasing its reference on the
+// underlying forward when the connection is closed.
+type pooledConn struct {
+	net.Conn
+	release   func()
+	closeOnce sync.Once
+}
+
+func (c *pooledConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(c.release)
+	return err
+}
+
+var _ fmt.Stringer = pooledForwarderKey{}
+
+func (k pooledForwarderKey) String() string {
+	if k.service != (types.NamespacedName{}) {
+		return fmt.Sprintf("svc:%s/%s:%s", k.service.Namespace, k.service.Name, k.port)
+	}
+	return fmt.Sprintf("%s/%s:%s", k.pod.Namespace, k.pod.Name, k.port)
+}
@@ -0,0 +1,150 @@
+package portforward
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_ForwarderPool_acquire_reusesForwarder(t *testing.T) {
+	var factoryCalls int
+
+	pool := NewForwarderPool()
+	pool.IdleTTL = 10 * time.Millisecond
+
+	addr := "foo.bar.pod.cluster.local:9200"
+
+	// seed the pool with a forwarder whose factory counts how many times its underlying
+	// forward is started; acquire must hand back this same forwarder rather than build a new one.
+	newForwarder := func() (*podForwarder, error) {
+		f, err := NewPodForwarder("tcp", addr)
+		require.NoError(t, err)
+		f.portForwarderFactory = func(namespace, podName, podPort, bindHost string) PortForwarder {
+			factoryCalls++
+			return &stubPortForwarder{address: net.JoinHostPort(bindHost, "12345")}
+		}
+		f.dialerFunc = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, nil
+		}
+		return f, nil
+	}
+
+	key := pooledForwarderKey{pod: types.NamespacedName{Namespace: "bar", Name: "foo"}, port: "9200"}
+
+	forwarder, err := newForwarder()
+	require.NoError(t, err)
+	entryCtx, cancel := context.WithCancel(context.Background())
+	entry := &pooledForwarder{forwarder: forwarder, cancel: cancel, done: make(chan struct{})}
+	pool.forwarders = map[pooledForwarderKey]*pooledForwarder{key: entry}
+	go func() {
+		defer close(entry.done)
+		_ = forwarder.Run(entryCtx)
+	}()
+
+	got1, release1, err := pool.acquire("tcp", addr)
+	require.NoError(t, err)
+	got2, release2, err := pool.acquire("tcp", addr)
+	require.NoError(t, err)
+
+	assert.Same(t, forwarder, got1)
+	assert.Same(t, forwarder, got2)
+
+	// wait for Run to have started the forward before reading the counter
+	<-forwarder.initChan
+	assert.Equal(t, 1, factoryCalls, "the second acquire should reuse the cached forwarder")
+
+	release1()
+	release2()
+
+	// give the idle-eviction timer a chance to run
+	time.Sleep(50 * time.Millisecond)
+
+	pool.mu.Lock()
+	_, stillCached := pool.forwarders[key]
+	pool.mu.Unlock()
+	assert.False(t, stillCached, "forwarder should be evicted once idle past its TTL")
+}
+
+func Test_poolKeyFor_podAndServiceDontCollide(t *testing.T) {
+	podKey := poolKeyFor(&parsedAddr{kind: addrKindPod, pod: types.NamespacedName{Namespace: "bar", Name: "foo"}}, "9200")
+	svcKey := poolKeyFor(&parsedAddr{kind: addrKindService, service: types.NamespacedName{Namespace: "bar", Name: "foo"}}, "9200")
+
+	assert.NotEqual(t, podKey, svcKey, "a pod and a same-named Service in the same namespace must not share a cache entry")
+}
+
+func Test_ForwarderPool_Evict(t *testing.T) {
+	pool := NewForwarderPool()
+
+	forwarder, err := NewPodForwarder("tcp", "foo.bar.pod.cluster.local:9200")
+	require.NoError(t, err)
+	forwarder.portForwarderFactory = func(namespace, podName, podPort, bindHost string) PortForwarder {
+		return &stubPortForwarder{address: net.JoinHostPort(bindHost, "12345")}
+	}
+
+	key := pooledForwarderKey{pod: types.NamespacedName{Namespace: "bar", Name: "foo"}, port: "9200"}
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &pooledForwarder{forwarder: forwarder, cancel: cancel, done: make(chan struct{}), refCount: 1}
+	pool.forwarders = map[pooledForwarderKey]*pooledForwarder{key: entry}
+	go func() {
+		defer close(entry.done)
+		_ = forwarder.Run(ctx)
+	}()
+
+	pool.Evict(types.NamespacedName{Namespace: "bar", Name: "foo"})
+
+	pool.mu.Lock()
+	_, stillCached := pool.forwarders[key]
+	pool.mu.Unlock()
+	assert.False(t, stillCached, "Evict should tear down a forward even while still in use")
+}
+
+func Test_ForwarderPool_podDeleteHandler_evictsOnPodDeletion(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "bar", Name: "foo"}}
+	cs := fake.NewSimpleClientset(pod)
+
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	informer := factory.Core().V1().Pods().Informer()
+
+	pool := NewForwarderPool()
+
+	forwarder, err := NewPodForwarder("tcp", "foo.bar.pod.cluster.local:9200")
+	require.NoError(t, err)
+	forwarder.portForwarderFactory = func(namespace, podName, podPort, bindHost string) PortForwarder {
+		return &stubPortForwarder{address: net.JoinHostPort(bindHost, "12345")}
+	}
+
+	key := pooledForwarderKey{pod: types.NamespacedName{Namespace: "bar", Name: "foo"}, port: "9200"}
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &pooledForwarder{forwarder: forwarder, cancel: cancel, done: make(chan struct{}), refCount: 1}
+	pool.forwarders = map[pooledForwarderKey]*pooledForwarder{key: entry}
+	go func() {
+		defer close(entry.done)
+		_ = forwarder.Run(ctx)
+	}()
+
+	informer.AddEventHandler(pool.podDeleteHandler())
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go informer.Run(stopCh)
+	require.True(t, cache.WaitForCacheSync(stopCh, informer.HasSynced))
+
+	require.NoError(t, cs.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{}))
+
+	require.Eventually(t, func() bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		_, stillCached := pool.forwarders[key]
+		return !stillCached
+	}, 5*time.Second, 10*time.Millisecond, "the informer's DeleteFunc handler should evict the forward for the deleted pod")
+}
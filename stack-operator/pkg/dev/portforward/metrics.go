@@ -0,0 +1,46 @@
+package portforward
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	dialsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "eck",
+		Subsystem: "portforward",
+		Name:      "dials_total",
+		Help:      "Total number of DialContext calls, by target namespace and result.",
+	}, []string{"namespace", "result"})
+
+	activeForwards = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "eck",
+		Subsystem: "portforward",
+		Name:      "active_forwards",
+		Help:      "Number of port-forwards currently running, by target namespace.",
+	}, []string{"namespace"})
+
+	dialLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "eck",
+		Subsystem: "portforward",
+		Name:      "dial_latency_seconds",
+		Help:      "Latency of DialContext calls, by target namespace.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"namespace"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(dialsTotal, activeForwards, dialLatencySeconds)
+}
+
+// observeDial records a completed DialContext call for namespace in the package's metrics.
+func observeDial(namespace string, start time.Time, err error) {
+	dialLatencySeconds.WithLabelValues(namespace).Observe(time.Since(start).Seconds())
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	dialsTotal.WithLabelValues(namespace, result).Inc()
+}
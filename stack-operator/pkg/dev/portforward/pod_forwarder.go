@@ -0,0 +1,465 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// DefaultReadyTimeout is how long Run waits for a forward to become ready before reporting
+// ErrForwardTimeout, when no WithReadyTimeout option is given.
+const DefaultReadyTimeout = 30 * time.Second
+
+// DefaultBindHost is the local address a forward is bound to when no WithBindHost option is
+// given. Override it (eg. to "::1") on an IPv6-only node, or in tests that want to exercise a
+// non-default bind address.
+const DefaultBindHost = "127.0.0.1"
+
+// serviceReconnectBackoff is how long Run waits before re-resolving and retrying a Service
+// forward that dropped, or found no ready endpoint.
+const serviceReconnectBackoff = 2 * time.Second
+
+// PortForwarder abstracts over the concrete implementation that forwards ports to a pod,
+// making it possible to fake it out in tests. Start/Address/Close/WaitForStop lets a forward
+// be started once, dialed many times, and torn down explicitly, rather than being tied to the
+// lifetime of a single blocking call.
+type PortForwarder interface {
+	// Start establishes the forward and blocks until it is ready to accept connections, or ctx
+	// is done, or setup fails.
+	Start(ctx context.Context) error
+	// Address returns the local host:port the forward is bound to. Only valid after Start
+	// returns successfully.
+	Address() string
+	// Close tears down the forward, waiting for it to fully stop, and returns the error that
+	// caused it to stop on its own, if any. It is safe to call more than once.
+	Close() error
+	// WaitForStop blocks until the forward has stopped, however that came about.
+	WaitForStop()
+}
+
+// PortForwarderFactory builds a PortForwarder for podPort on the named pod, bound locally to
+// bindHost. Construction is cheap and cannot fail; Start does the actual work.
+type PortForwarderFactory func(namespace, podName, podPort, bindHost string) PortForwarder
+
+// dialerFunc mirrors net.Dialer.DialContext, letting tests and alternative transports
+// (eg. the in-cluster exec dialer) stand in for the default net.Dialer.
+type dialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// DialerStrategy selects how a podForwarder reaches its target once it has been dialed.
+type DialerStrategy string
+
+const (
+	// DialerStrategySPDY opens a SPDY port-forward to the API server and dials the local
+	// address it binds. This is the default.
+	DialerStrategySPDY DialerStrategy = "spdy"
+
+	// DialerStrategyInClusterExec reaches the pod by exec-ing a socat process into its
+	// container and streaming the connection over the exec subresource, instead of keeping a
+	// SPDY port-forward running. Every dial opens its own exec stream through the API server,
+	// and the target container must have socat installed.
+	DialerStrategyInClusterExec DialerStrategy = "in-cluster-exec"
+)
+
+// PodForwarderOption configures a podForwarder at construction time.
+type PodForwarderOption func(*podForwarder)
+
+// WithDialerStrategy selects how DialContext reaches the target pod. Defaults to
+// DialerStrategySPDY.
+func WithDialerStrategy(strategy DialerStrategy) PodForwarderOption {
+	return func(f *podForwarder) {
+		f.dialerStrategy = strategy
+	}
+}
+
+// WithOnError registers a hook invoked whenever the forward fails, letting callers
+// distinguish a terminal failure from a transient one instead of only seeing the error
+// returned from a blocked DialContext call.
+func WithOnError(onError OnErrorFunc) PodForwarderOption {
+	return func(f *podForwarder) {
+		f.onError = onError
+	}
+}
+
+// WithReadyTimeout overrides how long Run waits for the forward to become ready before
+// reporting ErrForwardTimeout. Defaults to DefaultReadyTimeout.
+func WithReadyTimeout(timeout time.Duration) PodForwarderOption {
+	return func(f *podForwarder) {
+		f.readyTimeout = timeout
+	}
+}
+
+// WithBindHost overrides the local address a forward is bound to, for DialerStrategySPDY.
+// Defaults to DefaultBindHost. Has no effect under DialerStrategyInClusterExec, which never
+// binds locally.
+func WithBindHost(host string) PodForwarderOption {
+	return func(f *podForwarder) {
+		f.bindHost = host
+	}
+}
+
+// podForwarder enables redirecting TCP connections to a pod, or to one of a Service's ready
+// endpoint pods, that may only be reachable from inside the cluster network.
+type podForwarder struct {
+	network, addr string
+	parsedAddr    *parsedAddr
+	podPort       string
+
+	dialerStrategy DialerStrategy
+	onError        OnErrorFunc
+	readyTimeout   time.Duration
+	bindHost       string
+
+	initOnce sync.Once
+	initChan chan struct{}
+	readyErr error
+
+	// addrMu guards address, which is rewritten on every (re)connect -- not just the first --
+	// so closing initChan alone isn't enough to synchronize it with a concurrent DialContext.
+	addrMu  sync.RWMutex
+	address string
+
+	portForwarderFactory PortForwarderFactory
+	dialerFunc           dialerFunc
+	execDialerFactory    execDialerFactory
+	endpointResolver     endpointResolver
+}
+
+// NewPodForwarder returns a podForwarder that can dial the pod, or Service, identified by
+// addr, which must be formatted as a cluster-local DNS name (see parsePodAddr) followed by
+// the port to forward to.
+func NewPodForwarder(network, addr string, opts ...PodForwarderOption) (*podForwarder, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := parsePodAddr(host)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &podForwarder{
+		network:              network,
+		addr:                 addr,
+		parsedAddr:           parsed,
+		podPort:              port,
+		dialerStrategy:       DialerStrategySPDY,
+		readyTimeout:         DefaultReadyTimeout,
+		bindHost:             DefaultBindHost,
+		initChan:             make(chan struct{}),
+		portForwarderFactory: defaultPortForwarderFactory,
+		dialerFunc:           (&net.Dialer{}).DialContext,
+		execDialerFactory:    newExecDialer,
+		endpointResolver:     defaultEndpointResolver{},
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f, nil
+}
+
+// Run creates a new port-forward and blocks until ctx is done or the port-forward fails.
+// Under DialerStrategyInClusterExec there is no persistent forward to maintain: every
+// DialContext call opens its own exec stream, so Run just waits for ctx to be done.
+//
+// For a Service address, the target pod is resolved fresh every time the forward needs
+// (re-)establishing, so a pod replaced by a rolling update is picked up on the next attempt.
+func (f *podForwarder) Run(ctx context.Context) error {
+	if f.dialerStrategy == DialerStrategyInClusterExec {
+		<-ctx.Done()
+		return nil
+	}
+
+	if f.parsedAddr.kind != addrKindService {
+		return f.runOnce(ctx, f.parsedAddr.targetPod(), f.podPort)
+	}
+
+	// A Service's backing pod can change over the forward's lifetime (eg. a rolling update),
+	// so every time the forward drops -- or there's no ready endpoint yet -- re-resolve and
+	// retry rather than giving up for good.
+	for {
+		pod, targetPort, err := f.endpointResolver.Resolve(ctx, f.parsedAddr.service, f.podPort)
+		if err != nil {
+			f.failReady(PhaseSetup, err)
+		} else {
+			_ = f.runOnce(ctx, pod, targetPort)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(serviceReconnectBackoff):
+		}
+	}
+}
+
+// runOnce establishes a single port-forward to pod:port and blocks until it stops or ctx is
+// done.
+func (f *podForwarder) runOnce(ctx context.Context, pod types.NamespacedName, port string) error {
+	forwarder := f.portForwarderFactory(pod.Namespace, pod.Name, port, f.bindHost)
+
+	startCtx, cancelStart := context.WithTimeout(ctx, f.readyTimeout)
+	defer cancelStart()
+
+	if err := forwarder.Start(startCtx); err != nil {
+		switch {
+		case ctx.Err() != nil:
+			f.failReady("", ctx.Err())
+			return nil
+		case startCtx.Err() == context.DeadlineExceeded:
+			f.failReady(PhaseReady, ErrForwardTimeout)
+			return ErrForwardTimeout
+		default:
+			f.failReady(PhaseSetup, err)
+			return err
+		}
+	}
+
+	f.setAddress(forwarder.Address())
+	f.initOnce.Do(func() { close(f.initChan) })
+
+	activeForwards.WithLabelValues(pod.Namespace).Inc()
+	defer activeForwards.WithLabelValues(pod.Namespace).Dec()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		forwarder.WaitForStop()
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-stopped:
+	}
+
+	if err := classifyForwardError(forwarder.Close()); err != nil {
+		f.reportError(PhaseDisconnect, err)
+		return err
+	}
+	return nil
+}
+
+// failReady unblocks any DialContext call waiting on f.initChan with err, then reports err
+// through the OnError hook unless phase is empty. Once the forward has become ready (or
+// failed) once, initChan is already closed and only the report happens.
+func (f *podForwarder) failReady(phase ErrorPhase, err error) {
+	f.initOnce.Do(func() {
+		f.readyErr = err
+		close(f.initChan)
+	})
+	if phase != "" {
+		f.reportError(phase, err)
+	}
+}
+
+func (f *podForwarder) reportError(phase ErrorPhase, err error) {
+	if f.onError != nil {
+		f.onError(phase, err)
+	}
+}
+
+// DialContext dials the target this forwarder was created for, blocking until the underlying
+// forward is ready or ctx is done.
+func (f *podForwarder) DialContext(ctx context.Context) (net.Conn, error) {
+	namespace := f.parsedAddr.pod.Namespace
+	if f.parsedAddr.kind != addrKindPod {
+		namespace = f.parsedAddr.service.Namespace
+	}
+
+	start := time.Now()
+	var conn net.Conn
+	var err error
+	if f.dialerStrategy == DialerStrategyInClusterExec {
+		conn, err = f.dialInClusterExec(ctx)
+	} else {
+		conn, err = f.dialSPDY(ctx)
+	}
+	observeDial(namespace, start, err)
+	return conn, err
+}
+
+func (f *podForwarder) dialInClusterExec(ctx context.Context) (net.Conn, error) {
+	pod, port := f.parsedAddr.targetPod(), f.podPort
+	if f.parsedAddr.kind == addrKindService {
+		resolved, targetPort, err := f.endpointResolver.Resolve(ctx, f.parsedAddr.service, f.podPort)
+		if err != nil {
+			return nil, err
+		}
+		pod, port = resolved, targetPort
+	}
+
+	dialer, err := f.execDialerFactory(pod)
+	if err != nil {
+		return nil, err
+	}
+	return dialer.DialContext(ctx, f.network, net.JoinHostPort("127.0.0.1", port))
+}
+
+func (f *podForwarder) dialSPDY(ctx context.Context) (net.Conn, error) {
+	select {
+	case <-f.initChan:
+		if f.readyErr != nil {
+			return nil, f.readyErr
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return f.dialerFunc(ctx, f.network, f.getAddress())
+}
+
+func (f *podForwarder) setAddress(address string) {
+	f.addrMu.Lock()
+	defer f.addrMu.Unlock()
+	f.address = address
+}
+
+func (f *podForwarder) getAddress() string {
+	f.addrMu.RLock()
+	defer f.addrMu.RUnlock()
+	return f.address
+}
+
+// randomAvailablePort asks the kernel for a free local port on host by briefly binding to
+// port 0.
+func randomAvailablePort(host string) (string, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	return port, err
+}
+
+var (
+	clientConfigOnce sync.Once
+	restConfig       *rest.Config
+	clientset        kubernetes.Interface
+	clientConfigErr  error
+)
+
+// getClientConfig lazily builds and caches the in-cluster (or kubeconfig) REST config and
+// clientset used to talk to the API server, shared by every podForwarder in the process.
+func getClientConfig() (*rest.Config, kubernetes.Interface, error) {
+	clientConfigOnce.Do(func() {
+		restConfig, clientConfigErr = ctrl.GetConfig()
+		if clientConfigErr != nil {
+			return
+		}
+		clientset, clientConfigErr = kubernetes.NewForConfig(restConfig)
+	})
+	return restConfig, clientset, clientConfigErr
+}
+
+func defaultPortForwarderFactory(namespace, podName, podPort, bindHost string) PortForwarder {
+	return &spdyPortForwarder{
+		namespace: namespace,
+		podName:   podName,
+		podPort:   podPort,
+		bindHost:  bindHost,
+	}
+}
+
+// spdyPortForwarder is the default PortForwarder, opening a SPDY port-forward to the API
+// server bound to an ephemeral local port on bindHost. The ephemeral port is an internal
+// detail of this implementation: callers only ever see the result through Address.
+type spdyPortForwarder struct {
+	namespace, podName, podPort, bindHost string
+
+	address    string
+	stopChan   chan struct{}
+	doneChan   chan struct{}
+	closeOnce  sync.Once
+	forwardErr error
+}
+
+func (s *spdyPortForwarder) Start(ctx context.Context) error {
+	cfg, cs, err := getClientConfig()
+	if err != nil {
+		return err
+	}
+
+	if _, err := cs.CoreV1().Pods(s.namespace).Get(s.podName, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ErrPodNotFound
+		}
+		return err
+	}
+
+	localPort, err := randomAvailablePort(s.bindHost)
+	if err != nil {
+		return err
+	}
+	s.address = net.JoinHostPort(s.bindHost, localPort)
+
+	req := cs.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(s.namespace).
+		Name(s.podName).
+		SubResource("portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(cfg)
+	if err != nil {
+		return err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	s.stopChan = make(chan struct{})
+	s.doneChan = make(chan struct{})
+	readyChan := make(chan struct{})
+
+	fw, err := portforward.NewOnAddresses(
+		dialer,
+		[]string{s.bindHost},
+		[]string{fmt.Sprintf("%s:%s", localPort, s.podPort)},
+		s.stopChan,
+		readyChan,
+		ioutil.Discard,
+		ioutil.Discard,
+	)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer close(s.doneChan)
+		s.forwardErr = fw.ForwardPorts()
+	}()
+
+	select {
+	case <-readyChan:
+		return nil
+	case <-s.doneChan:
+		return s.forwardErr
+	case <-ctx.Done():
+		_ = s.Close()
+		return ctx.Err()
+	}
+}
+
+func (s *spdyPortForwarder) Address() string { return s.address }
+
+func (s *spdyPortForwarder) Close() error {
+	s.closeOnce.Do(func() { close(s.stopChan) })
+	<-s.doneChan
+	return s.forwardErr
+}
+
+func (s *spdyPortForwarder) WaitForStop() { <-s.doneChan }
@@ -36,14 +36,69 @@ func NewPodForwarderWithTest(t *testing.T, network, addr string) *podForwarder {
 }
 
 type stubPortForwarder struct {
-	ctx context.Context
+	address  string
+	startErr error
+
+	closeOnce sync.Once
+	stopChan  chan struct{}
 }
 
-func (c *stubPortForwarder) ForwardPorts() error {
-	<-c.ctx.Done()
+func (c *stubPortForwarder) Start(ctx context.Context) error {
+	if c.startErr != nil {
+		return c.startErr
+	}
+	c.stopChan = make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		_ = c.Close()
+	}()
 	return nil
 }
 
+func (c *stubPortForwarder) Address() string { return c.address }
+
+func (c *stubPortForwarder) Close() error {
+	c.closeOnce.Do(func() { close(c.stopChan) })
+	return nil
+}
+
+func (c *stubPortForwarder) WaitForStop() { <-c.stopChan }
+
+// neverReadyPortForwarder never becomes ready: Start blocks until its ctx is done, simulating a
+// forward that never gets an answer from the API server.
+type neverReadyPortForwarder struct{}
+
+func (neverReadyPortForwarder) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+func (neverReadyPortForwarder) Address() string { return "" }
+func (neverReadyPortForwarder) Close() error    { return nil }
+func (neverReadyPortForwarder) WaitForStop()    {}
+
+// disconnectingPortForwarder becomes ready immediately, then reports itself stopped shortly
+// after, as if the underlying connection had dropped, with a Close error matching one of
+// forwardErrorPatterns.
+type disconnectingPortForwarder struct {
+	address string
+	stopped chan struct{}
+}
+
+func (f *disconnectingPortForwarder) Start(ctx context.Context) error {
+	f.address = net.JoinHostPort(DefaultBindHost, "12345")
+	f.stopped = make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(f.stopped)
+	}()
+	return nil
+}
+func (f *disconnectingPortForwarder) Address() string { return f.address }
+func (f *disconnectingPortForwarder) Close() error {
+	return errors.New("use of closed network connection")
+}
+func (f *disconnectingPortForwarder) WaitForStop() { <-f.stopped }
+
 func Test_podForwarder_DialContext(t *testing.T) {
 	type args struct {
 		ctx context.Context
@@ -60,23 +115,13 @@ func Test_podForwarder_DialContext(t *testing.T) {
 			name:      "pod should be forwarded",
 			forwarder: NewPodForwarderWithTest(t, "tcp", "foo.bar.pod.cluster.local:9200"),
 			tweaks: func(t *testing.T, f *podForwarder) {
-				f.ephemeralPortFinder = func() (string, error) {
-					return "12345", nil
-				}
-				f.portForwarderFactory = PortForwarderFactory(func(
-					ctx context.Context,
-					namespace, podName string,
-					ports []string,
-					readyChan chan struct{},
-				) (PortForwarder, error) {
+				f.portForwarderFactory = PortForwarderFactory(func(namespace, podName, podPort, bindHost string) PortForwarder {
 					assert.Equal(t, "bar", namespace)
 					assert.Equal(t, "foo", podName)
-					assert.Equal(t, []string{"12345:9200"}, ports)
-
-					// closing the readyChan to pretend we're ready
-					close(readyChan)
+					assert.Equal(t, "9200", podPort)
+					assert.Equal(t, DefaultBindHost, bindHost)
 
-					return &stubPortForwarder{ctx: ctx}, nil
+					return &stubPortForwarder{address: net.JoinHostPort(bindHost, "12345")}
 				})
 			},
 			wantDialArgs: []string{"127.0.0.1:12345"},
@@ -124,6 +169,99 @@ func Test_podForwarder_DialContext(t *testing.T) {
 	}
 }
 
+func Test_podForwarder_DialContext_setupError(t *testing.T) {
+	forwarder := NewPodForwarderWithTest(t, "tcp", "foo.bar.pod.cluster.local:9200")
+
+	var gotPhase ErrorPhase
+	var gotErr error
+	forwarder.onError = func(phase ErrorPhase, err error) {
+		gotPhase = phase
+		gotErr = err
+	}
+	forwarder.portForwarderFactory = PortForwarderFactory(func(namespace, podName, podPort, bindHost string) PortForwarder {
+		return &stubPortForwarder{startErr: ErrPodNotFound}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := forwarder.Run(ctx)
+		assert.Equal(t, ErrPodNotFound, err)
+	}()
+
+	_, err := forwarder.DialContext(ctx)
+	assert.Equal(t, ErrPodNotFound, err)
+
+	wg.Wait()
+
+	assert.Equal(t, PhaseSetup, gotPhase)
+	assert.Equal(t, ErrPodNotFound, gotErr)
+}
+
+func Test_podForwarder_DialContext_readyTimeout(t *testing.T) {
+	forwarder := NewPodForwarderWithTest(t, "tcp", "foo.bar.pod.cluster.local:9200")
+	forwarder.readyTimeout = 50 * time.Millisecond
+
+	var gotPhase ErrorPhase
+	var gotErr error
+	forwarder.onError = func(phase ErrorPhase, err error) {
+		gotPhase = phase
+		gotErr = err
+	}
+	forwarder.portForwarderFactory = PortForwarderFactory(func(namespace, podName, podPort, bindHost string) PortForwarder {
+		return neverReadyPortForwarder{}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := forwarder.Run(ctx)
+		assert.Equal(t, ErrForwardTimeout, err)
+	}()
+
+	_, err := forwarder.DialContext(ctx)
+	assert.Equal(t, ErrForwardTimeout, err)
+
+	wg.Wait()
+
+	assert.Equal(t, PhaseReady, gotPhase)
+	assert.Equal(t, ErrForwardTimeout, gotErr)
+}
+
+func Test_podForwarder_Run_portClosed(t *testing.T) {
+	forwarder := NewPodForwarderWithTest(t, "tcp", "foo.bar.pod.cluster.local:9200")
+	forwarder.dialerFunc = func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, nil
+	}
+
+	var gotPhase ErrorPhase
+	var gotErr error
+	forwarder.onError = func(phase ErrorPhase, err error) {
+		gotPhase = phase
+		gotErr = err
+	}
+	forwarder.portForwarderFactory = PortForwarderFactory(func(namespace, podName, podPort, bindHost string) PortForwarder {
+		return &disconnectingPortForwarder{}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := forwarder.Run(ctx)
+	assert.ErrorIs(t, err, ErrPortClosed)
+
+	assert.Equal(t, PhaseDisconnect, gotPhase)
+	assert.ErrorIs(t, gotErr, ErrPortClosed)
+}
+
 func Test_parsePodAddr(t *testing.T) {
 	type args struct {
 		addr string
@@ -131,13 +269,27 @@ func Test_parsePodAddr(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    types.NamespacedName
+		want    *parsedAddr
 		wantErr error
 	}{
 		{
-			name: "without subdomain",
+			name: "pod address",
 			args: args{addr: "foo.bar.pod.cluster.local"},
-			want: types.NamespacedName{Namespace: "bar", Name: "foo"},
+			want: &parsedAddr{kind: addrKindPod, pod: types.NamespacedName{Namespace: "bar", Name: "foo"}},
+		},
+		{
+			name: "service address",
+			args: args{addr: "es-http.bar.svc.cluster.local"},
+			want: &parsedAddr{kind: addrKindService, service: types.NamespacedName{Namespace: "bar", Name: "es-http"}},
+		},
+		{
+			name: "headless service pod address",
+			args: args{addr: "es-0.es-internal-http.bar.svc.cluster.local"},
+			want: &parsedAddr{
+				kind:    addrKindHeadlessServicePod,
+				pod:     types.NamespacedName{Name: "es-0"},
+				service: types.NamespacedName{Namespace: "bar", Name: "es-internal-http"},
+			},
 		},
 		{
 			name:    "invalid",
@@ -155,7 +307,7 @@ func Test_parsePodAddr(t *testing.T) {
 			}
 			assert.NoError(t, err)
 
-			assert.Equal(t, tt.want, *got)
+			assert.Equal(t, tt.want, got)
 		})
 	}
-}
\ No newline at end of file
+}